@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"chuanyun.io/esmeralda/collector/deadletter"
+	"chuanyun.io/esmeralda/collector/storage"
+	"chuanyun.io/esmeralda/collector/trace"
+	"chuanyun.io/esmeralda/setting"
+	"chuanyun.io/esmeralda/util"
+	gocache "github.com/patrickmn/go-cache"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/sirupsen/logrus"
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+var errIndexNotAcknowledged = errors.New("index create not acknowledged")
+
+var (
+	metricBulkIndexed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "esmeralda_bulk_documents_indexed_total",
+		Help: "Total number of documents successfully indexed by the bulk processor.",
+	}, []string{"cluster"})
+	metricBulkFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "esmeralda_bulk_documents_failed_total",
+		Help: "Total number of documents the bulk processor failed to index.",
+	}, []string{"cluster"})
+	metricBulkRetried = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "esmeralda_bulk_documents_retried_total",
+		Help: "Total number of documents resubmitted by the bulk processor after a failed execution.",
+	}, []string{"cluster"})
+)
+
+// Cluster owns the client, BulkProcessor, and index-exists cache for one
+// Elasticsearch cluster.
+type Cluster struct {
+	Name       string
+	Client     *elastic.Client
+	Processor  *elastic.BulkProcessor
+	Cache      *gocache.Cache
+	DeadLetter *deadletter.Router
+}
+
+// newCluster builds and starts the BulkProcessor for cfg. deadLetter may be
+// nil, in which case failed bulk items are only logged.
+func newCluster(ctx context.Context, cfg setting.ElasticsearchClusterConfig, deadLetter *deadletter.Router) (*Cluster, error) {
+	cluster := &Cluster{
+		Name:       cfg.Name,
+		DeadLetter: deadLetter,
+		Client:     cfg.Client,
+		Cache:      gocache.New(60*time.Second, 60*time.Second),
+	}
+
+	bulkActions := cfg.BulkActions
+	if bulkActions <= 0 {
+		bulkActions = 1000
+	}
+	bulkSize := cfg.BulkSize
+	if bulkSize <= 0 {
+		bulkSize = 5 << 20 // 5MB
+	}
+	flushInterval := cfg.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = 5 * time.Second
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = 2
+	}
+
+	processor, err := cfg.Client.BulkProcessor().
+		Name("esmeralda-bulk-processor-" + cfg.Name).
+		Workers(workers).
+		BulkActions(bulkActions).
+		BulkSize(bulkSize).
+		FlushInterval(flushInterval).
+		Stats(true).
+		Backoff(elastic.NewExponentialBackoff(100*time.Millisecond, 30*time.Second)).
+		Before(cluster.beforeBulk).
+		After(cluster.afterBulk).
+		Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cluster.Processor = processor
+
+	return cluster, nil
+}
+
+func (cluster *Cluster) beforeBulk(executionId int64, requests []elastic.BulkableRequest) {
+	logrus.WithFields(logrus.Fields{
+		"cluster":   cluster.Name,
+		"execution": executionId,
+		"requests":  len(requests),
+	}).Debug("bulk processor flushing")
+}
+
+func (cluster *Cluster) afterBulk(executionId int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"cluster":   cluster.Name,
+			"error":     err,
+			"execution": executionId,
+		}).Warn(util.Message("bulk processor execution error"))
+		metricBulkRetried.WithLabelValues(cluster.Name).Add(float64(len(requests)))
+		return
+	}
+
+	if response == nil {
+		return
+	}
+
+	for i, item := range response.Indexed() {
+		if item.Status != 201 && item.Status != 200 {
+			metricBulkFailed.WithLabelValues(cluster.Name).Inc()
+			logrus.WithFields(logrus.Fields{
+				"cluster": cluster.Name,
+				"status":  item.Status,
+				"index":   item.Index,
+				"error":   item.Error,
+			}).Warn(util.Message("bulk save documents value state error"))
+			cluster.sendBulkFailureToDeadLetter(i, item, requests)
+			continue
+		}
+		metricBulkIndexed.WithLabelValues(cluster.Name).Inc()
+	}
+}
+
+func (cluster *Cluster) sendBulkFailureToDeadLetter(index int, item *elastic.BulkResponseItem, requests []elastic.BulkableRequest) {
+	if cluster.DeadLetter == nil || index >= len(requests) {
+		return
+	}
+
+	lines, err := requests[index].Source()
+	if err != nil {
+		return
+	}
+
+	errorMessage := ""
+	if item.Error != nil {
+		errorMessage = item.Error.Reason
+	}
+
+	cluster.DeadLetter.Send(deadletter.Record{
+		Class:   deadletter.ClassBulk,
+		Index:   item.Index,
+		Error:   errorMessage,
+		Payload: []byte(strings.Join(lines, "\n")),
+	})
+}
+
+// ensureIndex makes sure document.IndexName exists on this cluster before it
+// is handed to the bulk processor, caching positive results for a minute.
+func (cluster *Cluster) ensureIndex(ctx context.Context, document *trace.Document) error {
+	cacheKey := document.IndexName + document.TypeName
+
+	if _, found := cluster.Cache.Get(cacheKey); found {
+		return nil
+	}
+
+	exists, err := cluster.Client.IndexExists(document.IndexName).Do(ctx)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"cluster": cluster.Name,
+			"error":   err,
+			"index":   document.IndexName,
+		}).Warn(util.Message("index exists query error"))
+		return err
+	}
+	if !exists {
+		createIndex, err := cluster.Client.
+			CreateIndex(document.IndexName).
+			BodyString(storage.Mappings[document.IndexBaseName]).
+			Do(ctx)
+
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"cluster": cluster.Name,
+				"error":   err,
+				"index":   document.IndexName,
+			}).Warn(util.Message("index create error"))
+			return err
+		}
+		if !createIndex.Acknowledged {
+			logrus.WithFields(logrus.Fields{
+				"cluster": cluster.Name,
+				"index":   document.IndexName,
+			}).Warn(util.Message("index create not acknowledged"))
+			return errIndexNotAcknowledged
+		}
+	}
+	cluster.Cache.Set(cacheKey, true, gocache.DefaultExpiration)
+
+	return nil
+}
@@ -2,30 +2,35 @@ package collector
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
-	"sync"
 	"time"
 
-	"chuanyun.io/esmeralda/collector/storage"
+	"chuanyun.io/esmeralda/collector/deadletter"
+	"chuanyun.io/esmeralda/collector/filter"
+	"chuanyun.io/esmeralda/collector/lag"
 	"chuanyun.io/esmeralda/collector/trace"
 	"chuanyun.io/esmeralda/setting"
 	"chuanyun.io/esmeralda/util"
 	"github.com/Shopify/sarama"
 	"github.com/julienschmidt/httprouter"
-	gocache "github.com/patrickmn/go-cache"
 	"github.com/sirupsen/logrus"
 	"github.com/wvanbergen/kafka/consumergroup"
 	"golang.org/x/sync/errgroup"
 	elastic "gopkg.in/olivere/elastic.v5"
 )
 
+// defaultFilterChainKey selects the filter chain applied to spans with no
+// more specific, topic-keyed chain configured.
+const defaultFilterChainKey = "default"
+
 type CollectorService struct {
-	Cache               *gocache.Cache
 	SpansProcessingChan chan *[]trace.Span
-	DocumentQueueChan   chan *[]trace.Document
-	DocumentQueue       []trace.Document
-	Mux                 *sync.Mutex
+	Clusters            map[string]*Cluster
 	Consumer            *consumergroup.ConsumerGroup
+	FilterChains        map[string]filter.Chain
+	LagEvaluator        *lag.Evaluator
+	DeadLetter          *deadletter.Router
 }
 
 var Service = NewCollectorService()
@@ -33,11 +38,84 @@ var Service = NewCollectorService()
 func NewCollectorService() *CollectorService {
 
 	return &CollectorService{
-		Cache:               gocache.New(60*time.Second, 60*time.Second),
 		SpansProcessingChan: make(chan *[]trace.Span),
-		DocumentQueueChan:   make(chan *[]trace.Document),
-		DocumentQueue:       []trace.Document{},
-		Mux:                 &sync.Mutex{},
+		Clusters:            map[string]*Cluster{},
+		FilterChains:        map[string]filter.Chain{},
+	}
+}
+
+// loadClusters builds one Cluster, each with its own BulkProcessor and
+// index-exists cache, per entry in setting.Settings.Elasticsearch.
+func (service *CollectorService) loadClusters(ctx context.Context) error {
+	clusters := make(map[string]*Cluster, len(setting.Settings.Elasticsearch))
+
+	for _, cfg := range setting.Settings.Elasticsearch {
+		cluster, err := newCluster(ctx, cfg, service.DeadLetter)
+		if err != nil {
+			return err
+		}
+		clusters[cfg.Name] = cluster
+	}
+
+	service.Clusters = clusters
+
+	return nil
+}
+
+func (service *CollectorService) closeClusters() error {
+	for _, cluster := range service.Clusters {
+		if err := cluster.Processor.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadFilterChains builds one filter.Chain per key of setting.Settings.Filters.
+// Keys are Kafka topics, except "default", which names the chain for spans
+// that arrive without a more specific match (e.g. via HTTPCollector); when no
+// "default" key is configured, such spans pass through unfiltered.
+func (service *CollectorService) loadFilterChains() error {
+	chains := make(map[string]filter.Chain, len(setting.Settings.Filters))
+
+	for topic, configs := range setting.Settings.Filters {
+		chain, err := filter.Build(configs)
+		if err != nil {
+			return err
+		}
+		chains[topic] = chain
+	}
+
+	service.FilterChains = chains
+
+	return nil
+}
+
+// filterChainFor resolves the chain for a span's originating Kafka topic,
+// falling back to the default chain when the topic has no dedicated one.
+func (service *CollectorService) filterChainFor(span *trace.Span) filter.Chain {
+	topic, _ := span.Tags["kafka.topic"].(string)
+
+	if chain, ok := service.FilterChains[topic]; ok {
+		return chain
+	}
+
+	return service.FilterChains[defaultFilterChainKey]
+}
+
+// tagSpansTopic stamps each span with the Kafka topic it was read from, so
+// filterChainFor can pick a topic-specific chain further down the pipeline.
+func tagSpansTopic(spans *[]trace.Span, topic string) {
+	if spans == nil {
+		return
+	}
+
+	for i := range *spans {
+		if (*spans)[i].Tags == nil {
+			(*spans)[i].Tags = map[string]interface{}{}
+		}
+		(*spans)[i].Tags["kafka.topic"] = topic
 	}
 }
 
@@ -45,18 +123,56 @@ func (service *CollectorService) Run(ctx context.Context) error {
 
 	logrus.Info("Initializing CollectorService")
 
+	if err := service.loadFilterChains(); err != nil {
+		return err
+	}
+
+	if err := service.loadDeadLetter(); err != nil {
+		return err
+	}
+
+	if err := service.loadClusters(ctx); err != nil {
+		return err
+	}
+
 	group, _ := errgroup.WithContext(ctx)
 	group.Go(func() error { return service.queueRoutine(ctx) })
-	group.Go(func() error { return service.documentRoutine(ctx) })
+	group.Go(func() error { return service.pipelineMetricsRoutine(ctx) })
+	group.Go(func() error { return service.DeadLetter.Run(ctx) })
+	group.Go(func() error {
+		<-ctx.Done()
+		return service.closeClusters()
+	})
+
+	evaluator, err := service.startLagEvaluator(ctx)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Warn(util.Message("lag evaluator unavailable, /status/lag will report 503"))
+	} else {
+		service.LagEvaluator = evaluator
+		group.Go(func() error { return service.LagEvaluator.Run(ctx, 30*time.Second) })
+	}
 
-	err := group.Wait()
+	err = group.Wait()
 
 	logrus.Info("Done CollectorService")
 
 	return err
 }
 
+// kafkaRoutine dispatches to the sarama ConsumerGroup consumer or, for one
+// release, the legacy wvanbergen/kafka+Zookeeper consumer, selected by
+// setting.Settings.Kafka.Sarama.Enabled so operators can migrate gradually.
 func (service *CollectorService) kafkaRoutine(ctx context.Context) error {
+	if setting.Settings.Kafka.Sarama.Enabled {
+		return service.saramaKafkaRoutine(ctx)
+	}
+
+	return service.legacyKafkaRoutine(ctx)
+}
+
+func (service *CollectorService) legacyKafkaRoutine(ctx context.Context) error {
 
 	consumerConfig := consumergroup.NewConfig()
 	consumerConfig.Offsets.ProcessingTimeout = 5 * time.Second
@@ -108,8 +224,16 @@ func (service *CollectorService) kafkaRoutine(ctx context.Context) error {
 					"error": err,
 					"trace": traceLog,
 				}).Warn("main: trace log decode to json error")
+				service.DeadLetter.Send(deadletter.Record{
+					Class:   deadletter.ClassDecode,
+					Topic:   message.Topic,
+					Error:   err.Error(),
+					Payload: message.Value,
+				})
+			} else {
+				tagSpansTopic(spans, message.Topic)
+				Service.SpansProcessingChan <- spans
 			}
-			Service.SpansProcessingChan <- spans
 			Service.Consumer.CommitUpto(message)
 		case <-ctx.Done():
 			logrus.Info("Done collector service queue routine")
@@ -124,126 +248,55 @@ func (service *CollectorService) queueRoutine(ctx context.Context) error {
 	var assignSpansToQueue = func(spans *[]trace.Span) {
 
 		for _, span := range *spans {
-			doc, err := span.AssembleDocument()
+			filtered, drop, err := service.filterChainFor(&span).Apply(ctx, &span)
 			if err != nil {
 				logrus.WithFields(logrus.Fields{
 					"error": err,
 					"span":  span,
-				}).Warn(util.Message("span encode to json error"))
+				}).Warn(util.Message("span filter chain error"))
 				continue
 			}
-			service.Mux.Lock()
-			if len(service.DocumentQueue) < setting.Settings.Elasticsearch.Bulk {
-				service.DocumentQueue = append(service.DocumentQueue, *doc)
-			} else {
-				var queue = make([]trace.Document, len(service.DocumentQueue))
-				copy(queue, service.DocumentQueue)
-				service.DocumentQueueChan <- &queue
-				service.DocumentQueue = []trace.Document{}
+			if drop {
+				continue
 			}
-			service.Mux.Unlock()
-		}
-	}
-
-	for {
-		select {
-		case spans := <-Service.SpansProcessingChan:
-			assignSpansToQueue(spans)
-		case <-ctx.Done():
-			logrus.Info("Done collector service queue routine")
-			return ctx.Err()
-		}
-	}
-}
-
-func (service *CollectorService) documentRoutine(ctx context.Context) error {
-	logrus.Info("Start collector service document routine")
-
-	var bulkSaveDocument = func(documents *[]trace.Document) {
+			span = *filtered
 
-		bulkRequest := setting.Settings.Elasticsearch.Client.Bulk()
-
-		for _, document := range *documents {
-			cacheKey := document.IndexName + document.TypeName
+			doc, err := span.AssembleDocument()
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err,
+					"span":  span,
+				}).Warn(util.Message("span encode to json error"))
 
-			if _, found := service.Cache.Get(cacheKey); !found {
-				exists, err := setting.Settings.Elasticsearch.Client.IndexExists(document.IndexName).Do(ctx)
-				if err != nil {
-					logrus.WithFields(logrus.Fields{
-						"error": err,
-						"index": document.IndexName,
-					}).Warn(util.Message("index exists query error"))
-					continue
-				}
-				if !exists {
-					createIndex, err := setting.Settings.Elasticsearch.Client.
-						CreateIndex(document.IndexName).
-						BodyString(storage.Mappings[document.IndexBaseName]).
-						Do(ctx)
-
-					if err != nil {
-						logrus.WithFields(logrus.Fields{
-							"error": err,
-							"index": document.IndexName,
-						}).Warn(util.Message("index create error"))
-						continue
-					}
-					if !createIndex.Acknowledged {
-						logrus.WithFields(logrus.Fields{
-							"error": err,
-							"index": document.IndexName,
-						}).Warn(util.Message("index create not acknowledged"))
-						continue
-					}
+				if rendered, marshalErr := json.Marshal(span); marshalErr == nil {
+					service.DeadLetter.Send(deadletter.Record{
+						Class:   deadletter.ClassAssemble,
+						Error:   err.Error(),
+						Payload: rendered,
+					})
 				}
-				service.Cache.Set(cacheKey, true, gocache.DefaultExpiration)
+				continue
 			}
 
-			indexRequest := elastic.NewBulkIndexRequest().
-				Index(document.IndexName).
-				Type(document.TypeName).
-				Doc(document.Payload)
-
-			bulkRequest = bulkRequest.Add(indexRequest)
-		}
-
-		bulkResponse, err := bulkRequest.Do(ctx)
-		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"error": err,
-			}).Warn(util.Message("bulk save documents error"))
-
-			return
-		}
-		if bulkResponse == nil {
-			logrus.WithFields(logrus.Fields{
-				"error": err,
-			}).Warn(util.Message("bulk save documents response error"))
-
-			return
-		}
-
-		indexed := bulkResponse.Indexed()
-
-		if len(indexed) > 0 {
-			for _, value := range indexed {
-				if value.Status != 201 {
-					logrus.WithFields(logrus.Fields{
-						"status": value.Status,
-						"index":  value.Index,
-						"error":  value.Error,
-					}).Warn(util.Message("bulk save documents value state error"))
+			for _, cluster := range service.resolveClusters(doc) {
+				if err := cluster.ensureIndex(ctx, doc); err != nil {
+					continue
 				}
+
+				cluster.Processor.Add(elastic.NewBulkIndexRequest().
+					Index(doc.IndexName).
+					Type(doc.TypeName).
+					Doc(doc.Payload))
 			}
 		}
 	}
 
 	for {
 		select {
-		case queue := <-Service.DocumentQueueChan:
-			bulkSaveDocument(queue)
+		case spans := <-Service.SpansProcessingChan:
+			assignSpansToQueue(spans)
 		case <-ctx.Done():
-			logrus.Info("Done collector service document routine")
+			logrus.Info("Done collector service queue routine")
 			return ctx.Err()
 		}
 	}
@@ -265,6 +318,12 @@ func HTTPCollector(w http.ResponseWriter, r *http.Request, _ httprouter.Params)
 			"trace": body,
 		}).Warn(util.Message("trace log decode to json error"))
 
+		Service.DeadLetter.Send(deadletter.Record{
+			Class:   deadletter.ClassDecode,
+			Error:   err.Error(),
+			Payload: []byte(body),
+		})
+
 		w.Write([]byte(`{"msg": "error trace log"}`))
 
 		return
@@ -0,0 +1,115 @@
+// Package deadletter routes failed decode, assemble, and bulk-index records
+// to a per-class Sink.
+package deadletter
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Class identifies which stage of the pipeline produced a Record.
+type Class string
+
+const (
+	// ClassDecode covers trace.GetMessageBody/trace.ToSpans failures on a raw message.
+	ClassDecode Class = "decode"
+	// ClassAssemble covers span.AssembleDocument failures.
+	ClassAssemble Class = "assemble"
+	// ClassBulk covers non-2xx items reported by a cluster's BulkProcessor After callback.
+	ClassBulk Class = "bulk"
+)
+
+// Record is one failed item. Payload carries the raw message, the span, or
+// the rendered document depending on Class.
+type Record struct {
+	Class   Class  `json:"class"`
+	Topic   string `json:"topic,omitempty"`
+	Index   string `json:"index,omitempty"`
+	Error   string `json:"error"`
+	Payload []byte `json:"payload"`
+}
+
+// Sink persists dead-lettered records somewhere durable.
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+	Close() error
+}
+
+// Router fans records out to the Sink configured for their Class.
+type Router struct {
+	sinks map[Class]Sink
+	queue chan Record
+}
+
+// NewRouter builds a Router. sinks may omit a Class entirely, in which case
+// records of that class are dropped and counted via metricUnrouted.
+func NewRouter(sinks map[Class]Sink, bufferSize int) *Router {
+	if bufferSize <= 0 {
+		bufferSize = 1000
+	}
+
+	return &Router{
+		sinks: sinks,
+		queue: make(chan Record, bufferSize),
+	}
+}
+
+// Send enqueues record for delivery. It never blocks: when the buffer is
+// full the record is dropped and counted via metricDropped.
+func (router *Router) Send(record Record) {
+	if _, ok := router.sinks[record.Class]; !ok {
+		metricUnrouted.WithLabelValues(string(record.Class)).Inc()
+		return
+	}
+
+	select {
+	case router.queue <- record:
+	default:
+		metricDropped.WithLabelValues(string(record.Class)).Inc()
+		logrus.WithFields(logrus.Fields{
+			"class": record.Class,
+		}).Warn("dead letter queue full, dropping record")
+	}
+}
+
+// Run delivers queued records to their sink until ctx is done, then closes
+// every configured sink.
+func (router *Router) Run(ctx context.Context) error {
+	defer router.closeSinks()
+
+	for {
+		select {
+		case record := <-router.queue:
+			router.deliver(ctx, record)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (router *Router) deliver(ctx context.Context, record Record) {
+	sink, ok := router.sinks[record.Class]
+	if !ok {
+		return
+	}
+
+	if err := sink.Write(ctx, record); err != nil {
+		metricWriteErrors.WithLabelValues(string(record.Class)).Inc()
+		logrus.WithFields(logrus.Fields{
+			"class": record.Class,
+			"error": err,
+		}).Warn("dead letter sink write error")
+	}
+}
+
+func (router *Router) closeSinks() {
+	for class, sink := range router.sinks {
+		if err := sink.Close(); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"class": class,
+				"error": err,
+			}).Warn("dead letter sink close error")
+		}
+	}
+}
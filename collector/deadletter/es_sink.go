@@ -0,0 +1,38 @@
+package deadletter
+
+import (
+	"context"
+	"time"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// ESSink writes each Record as a document into a daily esmeralda-dlq-YYYY.MM.DD
+// index on client.
+type ESSink struct {
+	client *elastic.Client
+}
+
+func NewESSink(client *elastic.Client) *ESSink {
+	return &ESSink{client: client}
+}
+
+func (sink *ESSink) Write(ctx context.Context, record Record) error {
+	index := "esmeralda-dlq-" + time.Now().Format("2006.01.02")
+
+	_, err := sink.client.Index().
+		Index(index).
+		Type("record").
+		BodyJson(record).
+		Do(ctx)
+	if err != nil {
+		return err
+	}
+	metricWritten.WithLabelValues(string(record.Class)).Inc()
+
+	return nil
+}
+
+func (sink *ESSink) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+
+	lumberjack "gopkg.in/natefinch/lumberjack.v2"
+)
+
+// FileSink appends each Record as a JSONL line to a rotating log file.
+type FileSink struct {
+	mu     sync.Mutex
+	writer io.WriteCloser
+}
+
+// NewFileSink opens (creating if needed) a rotating JSONL file at path,
+// rotating once it reaches maxSizeMB and keeping maxBackups old files.
+func NewFileSink(path string, maxSizeMB, maxBackups int) *FileSink {
+	return &FileSink{
+		writer: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSizeMB,
+			MaxBackups: maxBackups,
+			Compress:   true,
+		},
+	}
+}
+
+func (sink *FileSink) Write(ctx context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if _, err := sink.writer.Write(line); err != nil {
+		return err
+	}
+	metricWritten.WithLabelValues(string(record.Class)).Inc()
+
+	return nil
+}
+
+func (sink *FileSink) Close() error {
+	return sink.writer.Close()
+}
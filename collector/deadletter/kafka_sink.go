@@ -0,0 +1,50 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Shopify/sarama"
+)
+
+// KafkaSink re-publishes each Record to a Kafka topic via a sarama.SyncProducer.
+type KafkaSink struct {
+	producer sarama.SyncProducer
+	topic    string
+}
+
+// NewKafkaSink builds a KafkaSink that publishes to topic on brokers.
+func NewKafkaSink(brokers []string, topic string) (*KafkaSink, error) {
+	config := sarama.NewConfig()
+	config.Producer.RequiredAcks = sarama.WaitForLocal
+	config.Producer.Return.Successes = true
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaSink{producer: producer, topic: topic}, nil
+}
+
+func (sink *KafkaSink) Write(ctx context.Context, record Record) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = sink.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: sink.topic,
+		Value: sarama.ByteEncoder(payload),
+	})
+	if err != nil {
+		return err
+	}
+	metricWritten.WithLabelValues(string(record.Class)).Inc()
+
+	return nil
+}
+
+func (sink *KafkaSink) Close() error {
+	return sink.producer.Close()
+}
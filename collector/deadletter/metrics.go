@@ -0,0 +1,25 @@
+package deadletter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "esmeralda_deadletter_records_written_total",
+		Help: "Total number of records successfully written to a dead letter sink.",
+	}, []string{"class"})
+	metricWriteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "esmeralda_deadletter_write_errors_total",
+		Help: "Total number of dead letter sink write failures.",
+	}, []string{"class"})
+	metricDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "esmeralda_deadletter_records_dropped_total",
+		Help: "Total number of records dropped because the dead letter queue was full.",
+	}, []string{"class"})
+	metricUnrouted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "esmeralda_deadletter_records_unrouted_total",
+		Help: "Total number of records dropped because their class has no sink configured.",
+	}, []string{"class"})
+)
@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"fmt"
+
+	"chuanyun.io/esmeralda/collector/deadletter"
+	"chuanyun.io/esmeralda/setting"
+)
+
+// loadDeadLetter builds the dead letter Router from setting.Settings.DeadLetter,
+// one Sink per configured failure class. Classes with no configured sink are
+// simply not routed, matching the previous log-and-drop behavior for them.
+func (service *CollectorService) loadDeadLetter() error {
+	sinks := make(map[deadletter.Class]deadletter.Sink, len(setting.Settings.DeadLetter.Sinks))
+
+	for class, cfg := range setting.Settings.DeadLetter.Sinks {
+		sink, err := buildDeadLetterSink(cfg)
+		if err != nil {
+			return err
+		}
+		sinks[deadletter.Class(class)] = sink
+	}
+
+	service.DeadLetter = deadletter.NewRouter(sinks, setting.Settings.DeadLetter.BufferSize)
+
+	return nil
+}
+
+func buildDeadLetterSink(cfg setting.DeadLetterSinkConfig) (deadletter.Sink, error) {
+	switch cfg.Type {
+	case "file":
+		return deadletter.NewFileSink(cfg.File.Path, cfg.File.MaxSizeMB, cfg.File.MaxBackups), nil
+	case "kafka":
+		return deadletter.NewKafkaSink(cfg.Kafka.Brokers, cfg.Kafka.Topic)
+	case "elasticsearch":
+		return deadletter.NewESSink(cfg.Elasticsearch.Client), nil
+	default:
+		return nil, fmt.Errorf("deadletter: unknown sink type %q", cfg.Type)
+	}
+}
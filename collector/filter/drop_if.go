@@ -0,0 +1,42 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+
+	"chuanyun.io/esmeralda/collector/trace"
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/vm"
+)
+
+// dropIf drops a span when its "expr" predicate evaluates to true. The
+// predicate is compiled once at chain-build time and evaluated against a
+// flattened view of the span's fixed fields and tags.
+type dropIf struct {
+	program *vm.Program
+}
+
+func newDropIf(params map[string]interface{}) (Filter, error) {
+	predicate, _ := params["expr"].(string)
+	if predicate == "" {
+		return nil, fmt.Errorf(`drop_if requires a non-empty "expr" param`)
+	}
+
+	program, err := expr.Compile(predicate, expr.AsBool())
+	if err != nil {
+		return nil, fmt.Errorf("drop_if: %v", err)
+	}
+
+	return &dropIf{program: program}, nil
+}
+
+func (f *dropIf) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	out, err := expr.Run(f.program, spanEnv(span))
+	if err != nil {
+		return span, false, err
+	}
+
+	drop, _ := out.(bool)
+
+	return span, drop, nil
+}
@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"context"
+
+	"chuanyun.io/esmeralda/collector/trace"
+)
+
+// removeFields deletes the named tags from every span it sees.
+type removeFields struct {
+	fields []string
+}
+
+func newRemoveFields(params map[string]interface{}) (Filter, error) {
+	return &removeFields{fields: stringSlice(params["fields"])}, nil
+}
+
+func (f *removeFields) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	for _, field := range f.fields {
+		delete(span.Tags, field)
+	}
+
+	return span, false, nil
+}
+
+// renameFields moves a tag from one key to another, dropping the original.
+type renameFields struct {
+	renames map[string]string
+}
+
+func newRenameFields(params map[string]interface{}) (Filter, error) {
+	return &renameFields{renames: stringMap(params["fields"])}, nil
+}
+
+func (f *renameFields) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	for from, to := range f.renames {
+		value, ok := span.Tags[from]
+		if !ok {
+			continue
+		}
+		span.Tags[to] = value
+		delete(span.Tags, from)
+	}
+
+	return span, false, nil
+}
+
+// addFields merges a fixed set of static tags into every span, overwriting
+// any existing tag with the same key.
+type addFields struct {
+	fields map[string]interface{}
+}
+
+func newAddFields(params map[string]interface{}) (Filter, error) {
+	fields, _ := params["fields"].(map[string]interface{})
+
+	return &addFields{fields: fields}, nil
+}
+
+func (f *addFields) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	if span.Tags == nil {
+		span.Tags = make(map[string]interface{}, len(f.fields))
+	}
+	for k, v := range f.fields {
+		span.Tags[k] = v
+	}
+
+	return span, false, nil
+}
@@ -0,0 +1,137 @@
+// Package filter provides a configurable chain of span transforms/predicates
+// that runs between Kafka/HTTP ingestion and ES document assembly.
+package filter
+
+import (
+	"context"
+	"fmt"
+
+	"chuanyun.io/esmeralda/collector/trace"
+)
+
+// Filter transforms or drops a span. The bool return signals "drop": when
+// true the span must not be processed further and the returned span is
+// discarded.
+type Filter interface {
+	Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error)
+}
+
+// Chain runs its filters in order, short-circuiting as soon as one of them
+// signals a drop or returns an error.
+type Chain []Filter
+
+func (chain Chain) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	var err error
+	var drop bool
+
+	for _, f := range chain {
+		span, drop, err = f.Apply(ctx, span)
+		if err != nil {
+			return span, false, err
+		}
+		if drop {
+			return span, true, nil
+		}
+	}
+
+	return span, false, nil
+}
+
+// Config is the declarative, per-topic description of a single chain entry
+// as loaded from setting.Settings.
+type Config struct {
+	Type   string                 `yaml:"type"`
+	Name   string                 `yaml:"name"`
+	Params map[string]interface{} `yaml:"params"`
+}
+
+// Build turns a list of declarative filter configs into an executable Chain.
+func Build(configs []Config) (Chain, error) {
+	chain := make(Chain, 0, len(configs))
+
+	for _, cfg := range configs {
+		f, err := build(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("filter %q: %v", cfg.Name, err)
+		}
+		chain = append(chain, f)
+	}
+
+	return chain, nil
+}
+
+func build(cfg Config) (Filter, error) {
+	switch cfg.Type {
+	case "drop_if":
+		return newDropIf(cfg.Params)
+	case "remove_fields":
+		return newRemoveFields(cfg.Params)
+	case "rename_fields":
+		return newRenameFields(cfg.Params)
+	case "add_fields":
+		return newAddFields(cfg.Params)
+	case "sampling":
+		return newSampling(cfg.Params)
+	case "transfer":
+		return newTransfer(cfg.Params)
+	default:
+		return nil, fmt.Errorf("unknown filter type %q", cfg.Type)
+	}
+}
+
+// spanEnv exposes span fields to predicate-style filters (drop_if) as a
+// flat map, with tags taking precedence over the fixed fields below.
+func spanEnv(span *trace.Span) map[string]interface{} {
+	env := map[string]interface{}{
+		"service":   span.ServiceName,
+		"operation": span.OperationName,
+		"duration":  span.Duration,
+	}
+	for k, v := range span.Tags {
+		env[k] = v
+	}
+
+	return env
+}
+
+func stringSlice(raw interface{}) []string {
+	values, _ := raw.([]interface{})
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+
+	return out
+}
+
+// float64Param coerces a declarative filter param to float64. YAML decodes
+// whole numbers (e.g. "max_per_second: 100") as int rather than float64, so
+// a plain type assertion against float64 misses that common case.
+func float64Param(raw interface{}) (float64, bool) {
+	switch v := raw.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func stringMap(raw interface{}) map[string]string {
+	values, _ := raw.(map[string]interface{})
+	out := make(map[string]string, len(values))
+	for k, v := range values {
+		if s, ok := v.(string); ok {
+			out[k] = s
+		}
+	}
+
+	return out
+}
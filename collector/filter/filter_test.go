@@ -0,0 +1,83 @@
+package filter
+
+import (
+	"context"
+	"testing"
+
+	"chuanyun.io/esmeralda/collector/trace"
+)
+
+func TestChainApplyShortCircuitsOnDrop(t *testing.T) {
+	chain := Chain{
+		dropAllFilter{},
+		panicFilter{t: t},
+	}
+
+	_, drop, err := chain.Apply(context.Background(), &trace.Span{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !drop {
+		t.Fatal("expected chain to report drop")
+	}
+}
+
+func TestChainApplyStopsOnError(t *testing.T) {
+	chain := Chain{
+		errFilter{},
+		panicFilter{t: t},
+	}
+
+	_, _, err := chain.Apply(context.Background(), &trace.Span{})
+	if err == nil {
+		t.Fatal("expected error from chain")
+	}
+}
+
+func TestDropIfDropsWhenPredicateTrue(t *testing.T) {
+	f, err := newDropIf(map[string]interface{}{"expr": `service == "noisy"`})
+	if err != nil {
+		t.Fatalf("newDropIf: %v", err)
+	}
+
+	_, drop, err := f.Apply(context.Background(), &trace.Span{ServiceName: "noisy"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !drop {
+		t.Fatal("expected span to be dropped")
+	}
+
+	_, drop, err = f.Apply(context.Background(), &trace.Span{ServiceName: "quiet"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if drop {
+		t.Fatal("expected span not to be dropped")
+	}
+}
+
+func TestDropIfRequiresExpr(t *testing.T) {
+	if _, err := newDropIf(map[string]interface{}{}); err == nil {
+		t.Fatal("expected error for missing expr param")
+	}
+}
+
+type dropAllFilter struct{}
+
+func (dropAllFilter) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	return span, true, nil
+}
+
+type errFilter struct{}
+
+func (errFilter) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	return span, false, context.DeadlineExceeded
+}
+
+type panicFilter struct{ t *testing.T }
+
+func (f panicFilter) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	f.t.Fatal("filter ran after chain should have short-circuited")
+	return span, false, nil
+}
@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+
+	"chuanyun.io/esmeralda/collector/trace"
+	"golang.org/x/time/rate"
+)
+
+// sampling drops spans probabilistically, then clamps whatever survives to
+// a per-service/operation rate limit.
+type sampling struct {
+	rate float64
+
+	maxPerSecond float64
+	limitersMu   sync.Mutex
+	limiters     map[string]*rate.Limiter
+}
+
+func newSampling(params map[string]interface{}) (Filter, error) {
+	s := &sampling{
+		rate:     1,
+		limiters: make(map[string]*rate.Limiter),
+	}
+
+	if v, ok := float64Param(params["rate"]); ok {
+		s.rate = v
+	}
+	if v, ok := float64Param(params["max_per_second"]); ok {
+		s.maxPerSecond = v
+	}
+
+	return s, nil
+}
+
+func (f *sampling) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	if f.rate < 1 && rand.Float64() >= f.rate {
+		return span, true, nil
+	}
+
+	if f.maxPerSecond <= 0 {
+		return span, false, nil
+	}
+
+	if !f.limiterFor(span).Allow() {
+		return span, true, nil
+	}
+
+	return span, false, nil
+}
+
+func (f *sampling) limiterFor(span *trace.Span) *rate.Limiter {
+	key := span.ServiceName + "\x00" + span.OperationName
+
+	f.limitersMu.Lock()
+	defer f.limitersMu.Unlock()
+
+	limiter, ok := f.limiters[key]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(f.maxPerSecond), int(f.maxPerSecond)+1)
+		f.limiters[key] = limiter
+	}
+
+	return limiter
+}
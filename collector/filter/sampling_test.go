@@ -0,0 +1,50 @@
+package filter
+
+import "testing"
+
+func TestNewSamplingCoercesIntParams(t *testing.T) {
+	f, err := newSampling(map[string]interface{}{
+		"rate":           1,
+		"max_per_second": 100,
+	})
+	if err != nil {
+		t.Fatalf("newSampling: %v", err)
+	}
+
+	s := f.(*sampling)
+	if s.rate != 1 {
+		t.Fatalf("rate = %v, want 1", s.rate)
+	}
+	if s.maxPerSecond != 100 {
+		t.Fatalf("maxPerSecond = %v, want 100", s.maxPerSecond)
+	}
+}
+
+func TestNewSamplingCoercesFloatParams(t *testing.T) {
+	f, err := newSampling(map[string]interface{}{
+		"rate":           0.5,
+		"max_per_second": 50.0,
+	})
+	if err != nil {
+		t.Fatalf("newSampling: %v", err)
+	}
+
+	s := f.(*sampling)
+	if s.rate != 0.5 {
+		t.Fatalf("rate = %v, want 0.5", s.rate)
+	}
+	if s.maxPerSecond != 50 {
+		t.Fatalf("maxPerSecond = %v, want 50", s.maxPerSecond)
+	}
+}
+
+func TestNewSamplingDefaultsRateToOne(t *testing.T) {
+	f, err := newSampling(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("newSampling: %v", err)
+	}
+
+	if f.(*sampling).rate != 1 {
+		t.Fatalf("rate = %v, want 1", f.(*sampling).rate)
+	}
+}
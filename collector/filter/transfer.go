@@ -0,0 +1,28 @@
+package filter
+
+import (
+	"context"
+
+	"chuanyun.io/esmeralda/collector/trace"
+)
+
+// transfer overrides the index a span's document will be written to based
+// on its span kind, letting e.g. client/server spans land in separate
+// indices without a second ingestion pipeline.
+type transfer struct {
+	mapping map[string]string
+}
+
+func newTransfer(params map[string]interface{}) (Filter, error) {
+	return &transfer{mapping: stringMap(params["mapping"])}, nil
+}
+
+func (f *transfer) Apply(ctx context.Context, span *trace.Span) (*trace.Span, bool, error) {
+	kind, _ := span.Tags["span.kind"].(string)
+
+	if indexBaseName, ok := f.mapping[kind]; ok {
+		span.IndexBaseName = indexBaseName
+	}
+
+	return span, false, nil
+}
@@ -0,0 +1,132 @@
+package collector
+
+import (
+	"context"
+
+	"chuanyun.io/esmeralda/collector/deadletter"
+	"chuanyun.io/esmeralda/collector/trace"
+	"chuanyun.io/esmeralda/setting"
+	"chuanyun.io/esmeralda/util"
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// saramaKafkaRoutine consumes setting.Settings.Kafka.Sarama.Topics via a
+// sarama.ConsumerGroup, relying on broker-managed offsets and
+// broker-coordinated rebalancing instead of the legacy Zookeeper-coordinated
+// consumer group. The rebalance strategy is sarama's default; incremental
+// cooperative rebalancing is not used.
+func (service *CollectorService) saramaKafkaRoutine(ctx context.Context) error {
+	cfg := setting.Settings.Kafka.Sarama
+
+	config, err := newSaramaConsumerConfig(cfg)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	group, err := sarama.NewConsumerGroup(cfg.Brokers, cfg.Group, config)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+	defer group.Close()
+
+	handler := &saramaConsumerGroupHandler{service: service}
+
+	go func() {
+		for err := range group.Errors() {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn(util.Message("sarama consumer group error"))
+		}
+	}()
+
+	for {
+		if err := group.Consume(ctx, cfg.Topics, handler); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Warn(util.Message("sarama consumer group consume error"))
+		}
+
+		if ctx.Err() != nil {
+			logrus.Info("Done collector service sarama kafka routine")
+			return ctx.Err()
+		}
+	}
+}
+
+func newSaramaConsumerConfig(cfg setting.SaramaConfig) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+
+	version := sarama.V1_0_0_0
+	if cfg.Version != "" {
+		parsed, err := sarama.ParseKafkaVersion(cfg.Version)
+		if err != nil {
+			return nil, err
+		}
+		version = parsed
+	}
+	config.Version = version
+
+	switch cfg.Offsets.Initial {
+	case "oldest":
+		config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	default:
+		config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	}
+
+	if cfg.SASL.Enabled {
+		config.Net.SASL.Enable = true
+		config.Net.SASL.User = cfg.SASL.User
+		config.Net.SASL.Password = cfg.SASL.Password
+	}
+
+	if cfg.TLS.Enabled {
+		config.Net.TLS.Enable = true
+	}
+
+	return config, nil
+}
+
+// saramaConsumerGroupHandler implements sarama.ConsumerGroupHandler, decoding
+// each claimed message and fanning it out to SpansProcessingChan the same way
+// the legacy consumer did, but only marks the message processed (committing
+// its offset) after the spans have been handed off successfully.
+type saramaConsumerGroupHandler struct {
+	service *CollectorService
+}
+
+func (h *saramaConsumerGroupHandler) Setup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *saramaConsumerGroupHandler) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (h *saramaConsumerGroupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	for message := range claim.Messages() {
+		traceLog, err := trace.GetMessageBody(message.Value)
+		if err != nil {
+		}
+
+		if traceLog == "" {
+			traceLog = string(message.Value[:])
+		}
+
+		spans, err := trace.ToSpans(traceLog)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+				"trace": traceLog,
+			}).Warn("main: trace log decode to json error")
+			h.service.DeadLetter.Send(deadletter.Record{
+				Class:   deadletter.ClassDecode,
+				Topic:   message.Topic,
+				Error:   err.Error(),
+				Payload: message.Value,
+			})
+		} else {
+			tagSpansTopic(spans, message.Topic)
+			h.service.SpansProcessingChan <- spans
+		}
+		session.MarkMessage(message, "")
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+// Package lag periodically compares Kafka broker high-water marks against
+// the offsets committed by esmeralda's consumer group, exposing Prometheus
+// gauges and a Burrow-style per-partition evaluation.
+package lag
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	StatusOK    = "OK"
+	StatusWarn  = "WARN"
+	StatusErr   = "ERR"
+	StatusStop  = "STOP"
+	StatusStall = "STALL"
+)
+
+var (
+	metricLag = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "esmeralda_kafka_lag",
+		Help: "Difference between the broker high-water mark and the committed offset.",
+	}, []string{"topic", "partition", "group"})
+	metricCommitted = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "esmeralda_kafka_offset_committed",
+		Help: "Last offset committed by the consumer group for a partition.",
+	}, []string{"topic", "partition", "group"})
+	metricHighwater = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "esmeralda_kafka_highwater",
+		Help: "Broker high-water mark for a partition.",
+	}, []string{"topic", "partition", "group"})
+)
+
+// OffsetSource reports the offset a consumer group has committed for a
+// partition, regardless of where that offset actually lives (Kafka itself
+// for sarama, Zookeeper for the legacy consumer).
+type OffsetSource interface {
+	CommittedOffset(topic string, partition int32) (int64, error)
+	Close() error
+}
+
+type sample struct {
+	committed int64
+	highwater int64
+}
+
+// PartitionStatus is one partition's Burrow-like evaluation.
+type PartitionStatus struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	Group     string `json:"group"`
+	Committed int64  `json:"committed"`
+	Highwater int64  `json:"highwater"`
+	Lag       int64  `json:"lag"`
+	Status    string `json:"status"`
+}
+
+// Evaluator samples offsets for a consumer group on a fixed interval and
+// keeps a sliding window per partition to tell a transient lag spike (WARN)
+// apart from a stalled (STALL) or dead (STOP) consumer.
+type Evaluator struct {
+	client       sarama.Client
+	offsets      OffsetSource
+	group        string
+	topics       []string
+	window       int
+	errThreshold int64
+
+	mu      sync.Mutex
+	history map[partitionKey][]sample
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// NewEvaluator builds an Evaluator that reads broker high-water marks from
+// client and committed offsets from offsets, for group consuming topics.
+// window is the number of samples kept per partition (STALL/STOP need at
+// least 2) and errThreshold is the lag above which a non-stalled partition
+// is reported as ERR rather than WARN.
+func NewEvaluator(client sarama.Client, offsets OffsetSource, group string, topics []string, window int, errThreshold int64) (*Evaluator, error) {
+	if window < 2 {
+		window = 2
+	}
+
+	return &Evaluator{
+		client:       client,
+		offsets:      offsets,
+		group:        group,
+		topics:       topics,
+		window:       window,
+		errThreshold: errThreshold,
+		history:      map[partitionKey][]sample{},
+	}, nil
+}
+
+// Run samples offsets every interval until ctx is done.
+func (e *Evaluator) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			e.sampleAll(ctx)
+		case <-ctx.Done():
+			return e.offsets.Close()
+		}
+	}
+}
+
+func (e *Evaluator) sampleAll(ctx context.Context) {
+	for _, topic := range e.topics {
+		partitions, err := e.client.Partitions(topic)
+		if err != nil {
+			continue
+		}
+
+		for _, partition := range partitions {
+			e.samplePartition(topic, partition)
+		}
+	}
+}
+
+func (e *Evaluator) samplePartition(topic string, partition int32) {
+	highwater, err := e.client.GetOffset(topic, partition, sarama.OffsetNewest)
+	if err != nil {
+		return
+	}
+
+	committed, err := e.offsets.CommittedOffset(topic, partition)
+	if err != nil {
+		return
+	}
+
+	key := partitionKey{topic: topic, partition: partition}
+	labels := []string{topic, strconv.Itoa(int(partition)), e.group}
+
+	e.mu.Lock()
+	hist := append(e.history[key], sample{committed: committed, highwater: highwater})
+	if len(hist) > e.window {
+		hist = hist[len(hist)-e.window:]
+	}
+	e.history[key] = hist
+	e.mu.Unlock()
+
+	metricCommitted.WithLabelValues(labels...).Set(float64(committed))
+	metricHighwater.WithLabelValues(labels...).Set(float64(highwater))
+	metricLag.WithLabelValues(labels...).Set(float64(highwater - committed))
+}
+
+// Statuses returns the current Burrow-like evaluation for every partition
+// sampled so far.
+func (e *Evaluator) Statuses() []PartitionStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	statuses := make([]PartitionStatus, 0, len(e.history))
+
+	for key, hist := range e.history {
+		last := hist[len(hist)-1]
+
+		statuses = append(statuses, PartitionStatus{
+			Topic:     key.topic,
+			Partition: key.partition,
+			Group:     e.group,
+			Committed: last.committed,
+			Highwater: last.highwater,
+			Lag:       last.highwater - last.committed,
+			Status:    e.evaluate(hist),
+		})
+	}
+
+	return statuses
+}
+
+func (e *Evaluator) evaluate(hist []sample) string {
+	last := hist[len(hist)-1]
+	lag := last.highwater - last.committed
+
+	if lag <= 0 {
+		return StatusOK
+	}
+	if len(hist) < e.window {
+		return StatusWarn
+	}
+
+	first := hist[0]
+	committedAdvancing := last.committed > first.committed
+	highwaterAdvancing := last.highwater > first.highwater
+
+	switch {
+	case !committedAdvancing && highwaterAdvancing:
+		return StatusStall
+	case !committedAdvancing && !highwaterAdvancing:
+		return StatusStop
+	case e.errThreshold > 0 && lag > e.errThreshold:
+		return StatusErr
+	default:
+		return StatusWarn
+	}
+}
+
@@ -0,0 +1,73 @@
+package lag
+
+import "testing"
+
+func newTestEvaluator(window int, errThreshold int64) *Evaluator {
+	return &Evaluator{window: window, errThreshold: errThreshold}
+}
+
+func TestEvaluateOKWhenCaughtUp(t *testing.T) {
+	e := newTestEvaluator(2, 100)
+	hist := []sample{{committed: 10, highwater: 10}}
+
+	if got := e.evaluate(hist); got != StatusOK {
+		t.Fatalf("evaluate() = %v, want %v", got, StatusOK)
+	}
+}
+
+func TestEvaluateWarnBelowWindow(t *testing.T) {
+	e := newTestEvaluator(3, 100)
+	hist := []sample{{committed: 0, highwater: 10}}
+
+	if got := e.evaluate(hist); got != StatusWarn {
+		t.Fatalf("evaluate() = %v, want %v", got, StatusWarn)
+	}
+}
+
+func TestEvaluateStallWhenHighwaterAdvancesButCommittedDoesNot(t *testing.T) {
+	e := newTestEvaluator(2, 100)
+	hist := []sample{
+		{committed: 5, highwater: 10},
+		{committed: 5, highwater: 20},
+	}
+
+	if got := e.evaluate(hist); got != StatusStall {
+		t.Fatalf("evaluate() = %v, want %v", got, StatusStall)
+	}
+}
+
+func TestEvaluateStopWhenNothingAdvances(t *testing.T) {
+	e := newTestEvaluator(2, 100)
+	hist := []sample{
+		{committed: 5, highwater: 10},
+		{committed: 5, highwater: 10},
+	}
+
+	if got := e.evaluate(hist); got != StatusStop {
+		t.Fatalf("evaluate() = %v, want %v", got, StatusStop)
+	}
+}
+
+func TestEvaluateErrAboveThreshold(t *testing.T) {
+	e := newTestEvaluator(2, 10)
+	hist := []sample{
+		{committed: 0, highwater: 100},
+		{committed: 5, highwater: 120},
+	}
+
+	if got := e.evaluate(hist); got != StatusErr {
+		t.Fatalf("evaluate() = %v, want %v", got, StatusErr)
+	}
+}
+
+func TestEvaluateWarnWhenBothAdvancingBelowThreshold(t *testing.T) {
+	e := newTestEvaluator(2, 1000)
+	hist := []sample{
+		{committed: 0, highwater: 10},
+		{committed: 5, highwater: 15},
+	}
+
+	if got := e.evaluate(hist); got != StatusWarn {
+		t.Fatalf("evaluate() = %v, want %v", got, StatusWarn)
+	}
+}
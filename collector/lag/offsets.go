@@ -0,0 +1,68 @@
+package lag
+
+import (
+	"github.com/Shopify/sarama"
+	"github.com/wvanbergen/kazoo-go"
+)
+
+// saramaOffsetSource reads committed offsets from Kafka via a sarama.OffsetManager.
+type saramaOffsetSource struct {
+	manager sarama.OffsetManager
+}
+
+// NewSaramaOffsetSource builds an OffsetSource backed by group's offsets on client.
+func NewSaramaOffsetSource(client sarama.Client, group string) (OffsetSource, error) {
+	manager, err := sarama.NewOffsetManagerFromClient(group, client)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saramaOffsetSource{manager: manager}, nil
+}
+
+func (s *saramaOffsetSource) CommittedOffset(topic string, partition int32) (int64, error) {
+	partitionOffsetManager, err := s.manager.ManagePartition(topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	defer partitionOffsetManager.AsyncClose()
+
+	offset, _ := partitionOffsetManager.NextOffset()
+
+	return offset, nil
+}
+
+func (s *saramaOffsetSource) Close() error {
+	return s.manager.Close()
+}
+
+// zookeeperOffsetSource reads committed offsets from the Zookeeper-backed
+// storage the legacy wvanbergen/kafka/consumergroup consumer commits to.
+type zookeeperOffsetSource struct {
+	kazoo *kazoo.Kazoo
+	group string
+}
+
+// NewZookeeperOffsetSource builds an OffsetSource backed by group's offsets
+// as stored in Zookeeper at servers, under the optional chroot.
+func NewZookeeperOffsetSource(servers []string, chroot string, group string) (OffsetSource, error) {
+	config := kazoo.NewConfig()
+	if chroot != "" && chroot != "/" {
+		config.Chroot = chroot
+	}
+
+	kz, err := kazoo.NewKazoo(servers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zookeeperOffsetSource{kazoo: kz, group: group}, nil
+}
+
+func (s *zookeeperOffsetSource) CommittedOffset(topic string, partition int32) (int64, error) {
+	return s.kazoo.Consumergroup(s.group).FetchOffset(topic, partition)
+}
+
+func (s *zookeeperOffsetSource) Close() error {
+	return s.kazoo.Close()
+}
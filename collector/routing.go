@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"encoding/json"
+	"hash/fnv"
+
+	"chuanyun.io/esmeralda/collector/trace"
+	"chuanyun.io/esmeralda/setting"
+)
+
+// resolveClusters picks which clusters document should be written to under
+// setting.Settings.ElasticsearchRouting: "fanout" (the default) writes to
+// every cluster for dual-write migrations, "route" evaluates Rules in order
+// and uses the first match, falling back to every cluster when none match.
+func (service *CollectorService) resolveClusters(document *trace.Document) []*Cluster {
+	routing := setting.Settings.ElasticsearchRouting
+
+	if routing.Mode != "route" {
+		return service.allClusters()
+	}
+
+	for _, rule := range routing.Rules {
+		if !matchRoutingRule(rule, document) {
+			continue
+		}
+		if cluster, ok := service.Clusters[rule.Cluster]; ok {
+			return []*Cluster{cluster}
+		}
+	}
+
+	return service.allClusters()
+}
+
+func (service *CollectorService) allClusters() []*Cluster {
+	clusters := make([]*Cluster, 0, len(service.Clusters))
+	for _, cluster := range service.Clusters {
+		clusters = append(clusters, cluster)
+	}
+
+	return clusters
+}
+
+func matchRoutingRule(rule setting.ElasticsearchRoutingRule, document *trace.Document) bool {
+	if len(rule.IndexBaseNames) > 0 {
+		for _, name := range rule.IndexBaseNames {
+			if name == document.IndexBaseName {
+				return true
+			}
+		}
+		return false
+	}
+
+	if rule.Tag != "" {
+		value, ok := documentTag(document, rule.Tag)
+		if !ok {
+			return false
+		}
+		for _, candidate := range rule.TagValues {
+			if candidate == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	if rule.HashMod > 0 {
+		h := fnv.New32a()
+		h.Write([]byte(document.IndexName))
+		return int(h.Sum32()%uint32(rule.HashMod)) == rule.HashRemainder
+	}
+
+	return false
+}
+
+// documentTag reads a top-level string field from document.Payload by name,
+// regardless of whether AssembleDocument produced a map or a struct: it
+// round-trips through JSON rather than asserting a concrete type, since
+// Payload is only guaranteed to be something elastic.BulkIndexRequest.Doc
+// can encode.
+func documentTag(document *trace.Document, tag string) (string, bool) {
+	encoded, err := json.Marshal(document.Payload)
+	if err != nil {
+		return "", false
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return "", false
+	}
+
+	value, ok := fields[tag].(string)
+
+	return value, ok
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"testing"
+
+	"chuanyun.io/esmeralda/collector/trace"
+	"chuanyun.io/esmeralda/setting"
+)
+
+func TestMatchRoutingRuleIndexBaseNames(t *testing.T) {
+	rule := setting.ElasticsearchRoutingRule{IndexBaseNames: []string{"spans"}}
+	doc := &trace.Document{IndexBaseName: "spans"}
+
+	if !matchRoutingRule(rule, doc) {
+		t.Fatal("expected match on index base name")
+	}
+
+	doc.IndexBaseName = "logs"
+	if matchRoutingRule(rule, doc) {
+		t.Fatal("expected no match for different index base name")
+	}
+}
+
+func TestMatchRoutingRuleTagMatchesStructPayload(t *testing.T) {
+	rule := setting.ElasticsearchRoutingRule{Tag: "tenant", TagValues: []string{"acme"}}
+	doc := &trace.Document{Payload: struct {
+		Tenant string `json:"tenant"`
+	}{Tenant: "acme"}}
+
+	if !matchRoutingRule(rule, doc) {
+		t.Fatal("expected match on tag value from struct payload")
+	}
+}
+
+func TestMatchRoutingRuleTagMatchesMapPayload(t *testing.T) {
+	rule := setting.ElasticsearchRoutingRule{Tag: "tenant", TagValues: []string{"acme"}}
+	doc := &trace.Document{Payload: map[string]interface{}{"tenant": "acme"}}
+
+	if !matchRoutingRule(rule, doc) {
+		t.Fatal("expected match on tag value from map payload")
+	}
+}
+
+func TestMatchRoutingRuleTagNoMatch(t *testing.T) {
+	rule := setting.ElasticsearchRoutingRule{Tag: "tenant", TagValues: []string{"acme"}}
+	doc := &trace.Document{Payload: map[string]interface{}{"tenant": "other"}}
+
+	if matchRoutingRule(rule, doc) {
+		t.Fatal("expected no match for different tag value")
+	}
+}
+
+func TestMatchRoutingRuleHashMod(t *testing.T) {
+	rule := setting.ElasticsearchRoutingRule{HashMod: 1, HashRemainder: 0}
+	doc := &trace.Document{IndexName: "spans-2026.07.26"}
+
+	if !matchRoutingRule(rule, doc) {
+		t.Fatal("expected every document to match mod 1")
+	}
+}
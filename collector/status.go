@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"chuanyun.io/esmeralda/collector/lag"
+	"chuanyun.io/esmeralda/setting"
+	"github.com/Shopify/sarama"
+	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	metricSpansProcessingChanFill = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "esmeralda_pipeline_spans_processing_chan_fill",
+		Help: "Number of span batches currently queued on SpansProcessingChan.",
+	})
+	metricBulkProcessorQueued = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "esmeralda_pipeline_bulk_processor_queued",
+		Help: "Number of documents queued across the bulk processor's workers.",
+	})
+)
+
+// startLagEvaluator builds a lag.Evaluator against whichever consumer group
+// is actually running.
+func (service *CollectorService) startLagEvaluator(ctx context.Context) (*lag.Evaluator, error) {
+	if setting.Settings.Kafka.Sarama.Enabled {
+		return service.startSaramaLagEvaluator(ctx)
+	}
+
+	return service.startLegacyLagEvaluator(ctx)
+}
+
+func (service *CollectorService) startSaramaLagEvaluator(ctx context.Context) (*lag.Evaluator, error) {
+	cfg := setting.Settings.Kafka.Sarama
+
+	config, err := newSaramaConsumerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := lag.NewSaramaOffsetSource(client, cfg.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	return lag.NewEvaluator(client, offsets, cfg.Group, cfg.Topics, 5, 10000)
+}
+
+// startLegacyLagEvaluator reads high-water marks via
+// setting.Settings.Kafka.Sarama.Brokers, since Zookeeper holds only the
+// legacy consumer's committed offsets, not the Kafka wire protocol.
+func (service *CollectorService) startLegacyLagEvaluator(ctx context.Context) (*lag.Evaluator, error) {
+	client, err := sarama.NewClient(setting.Settings.Kafka.Sarama.Brokers, sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	offsets, err := lag.NewZookeeperOffsetSource(
+		setting.Settings.Kafka.Zookeeper.Servers,
+		setting.Settings.Kafka.Zookeeper.Root,
+		setting.Settings.Kafka.Consumer.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	return lag.NewEvaluator(client, offsets, setting.Settings.Kafka.Consumer.Group, setting.Settings.Kafka.Topics, 5, 10000)
+}
+
+// collectPipelineMetrics refreshes the channel/bulk-processor depth gauges;
+// call it on a timer alongside the lag evaluator.
+func (service *CollectorService) collectPipelineMetrics() {
+	metricSpansProcessingChanFill.Set(float64(len(service.SpansProcessingChan)))
+
+	var queued int64
+	for _, cluster := range service.Clusters {
+		for _, worker := range cluster.Processor.Stats().Workers {
+			queued += worker.Queued
+		}
+	}
+	metricBulkProcessorQueued.Set(float64(queued))
+}
+
+// clusterStatus is one cluster's bulk processor stats as reported by
+// /status/clusters.
+type clusterStatus struct {
+	Name      string `json:"name"`
+	Indexed   int64  `json:"indexed"`
+	Created   int64  `json:"created"`
+	Updated   int64  `json:"updated"`
+	Deleted   int64  `json:"deleted"`
+	Succeeded int64  `json:"succeeded"`
+	Failed    int64  `json:"failed"`
+	Flushed   int64  `json:"flushed"`
+	Queued    int64  `json:"queued"`
+}
+
+// StatusClusters reports per-cluster bulk processor stats for every
+// Elasticsearch cluster esmeralda is configured to write to. It does not
+// query Elasticsearch cluster health.
+func StatusClusters(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	statuses := make([]clusterStatus, 0, len(Service.Clusters))
+
+	for name, cluster := range Service.Clusters {
+		stats := cluster.Processor.Stats()
+
+		var queued int64
+		for _, worker := range stats.Workers {
+			queued += worker.Queued
+		}
+
+		statuses = append(statuses, clusterStatus{
+			Name:      name,
+			Indexed:   stats.Indexed,
+			Created:   stats.Created,
+			Updated:   stats.Updated,
+			Deleted:   stats.Deleted,
+			Succeeded: stats.Succeeded,
+			Failed:    stats.Failed,
+			Flushed:   stats.Flushed,
+			Queued:    queued,
+		})
+	}
+
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// StatusLag reports a Burrow-style evaluation of Kafka consumer lag for
+// every partition the lag evaluator has sampled so far.
+func StatusLag(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if Service.LagEvaluator == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{"msg": "lag evaluator not running"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(Service.LagEvaluator.Statuses())
+}
+
+// pipelineMetricsRoutine refreshes the channel/bulk-processor depth gauges
+// on a fixed interval until ctx is done.
+func (service *CollectorService) pipelineMetricsRoutine(ctx context.Context) error {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			service.collectPipelineMetrics()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}